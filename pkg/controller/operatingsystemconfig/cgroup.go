@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package operatingsystemconfig
+
+import (
+	_ "embed"
+
+	"github.com/gardener/gardener-extension-os-coreos/pkg/controller/operatingsystemconfig/coreos"
+	"github.com/gardener/gardener-extension-os-coreos/pkg/controller/operatingsystemconfig/ignition"
+)
+
+// CgroupMode selects which cgroup hierarchy the configure-cgroups.service
+// unit assumes the node boots with. It is sourced from the provider config
+// so operators can pin a hierarchy instead of relying on auto-detection.
+type CgroupMode string
+
+const (
+	// CgroupModeAuto detects the hierarchy at script runtime by inspecting
+	// /sys/fs/cgroup, the same way k3s's agent picks a cgroup manager.
+	CgroupModeAuto CgroupMode = "auto"
+	// CgroupModeV1 leaves the kubelet's default (cgroup v1) config in place.
+	CgroupModeV1 CgroupMode = "v1"
+	// CgroupModeV2 forces the kubelet config patched for the unified
+	// cgroupsv2 hierarchy.
+	CgroupModeV2 CgroupMode = "v2"
+)
+
+const configureCgroupsUnitName = "configure-cgroups.service"
+
+//go:embed templates/configure-cgroups.sh.tpl
+var configureCgroupsTemplateContent string
+
+func configureCgroupsUnitContent(mode CgroupMode) string {
+	if mode == "" {
+		mode = CgroupModeAuto
+	}
+
+	return `[Unit]
+Description=Oneshot unit used to detect the cgroup hierarchy and patch the kubelet config accordingly.
+Before=containerd.service kubelet.service
+[Service]
+Type=oneshot
+EnvironmentFile=/etc/environment
+Environment=GARDENER_CGROUP_MODE=` + string(mode) + `
+ExecStart=/opt/bin/configure-cgroups.sh
+[Install]
+WantedBy=containerd.service kubelet.service
+`
+}
+
+func enableCGroups(cloudConfig *coreos.CloudConfig, mode CgroupMode) ([]string, error) {
+	cloudConfig.CoreOS.Units = append(
+		cloudConfig.CoreOS.Units,
+		coreos.Unit{
+			Name:    configureCgroupsUnitName,
+			Command: "start",
+			Enable:  true,
+			Content: configureCgroupsUnitContent(mode),
+		})
+
+	cloudConfig.WriteFiles = append(
+		cloudConfig.WriteFiles,
+		coreos.File{
+			Path:               "/opt/bin/configure-cgroups.sh",
+			RawFilePermissions: "0755",
+			Content:            configureCgroupsTemplateContent,
+		})
+
+	return []string{configureCgroupsUnitName}, nil
+}
+
+func enableCGroupsIgnition(cfg *ignition.Config, mode CgroupMode) ([]string, error) {
+	enabled := true
+
+	cfg.Systemd.Units = append(cfg.Systemd.Units, ignition.Unit{
+		Name:     configureCgroupsUnitName,
+		Enabled:  &enabled,
+		Contents: configureCgroupsUnitContent(mode),
+	})
+
+	cfg.Storage.Files = append(cfg.Storage.Files,
+		ignition.NewFile("/opt/bin/configure-cgroups.sh", 0755, []byte(configureCgroupsTemplateContent), false))
+
+	return []string{configureCgroupsUnitName}, nil
+}
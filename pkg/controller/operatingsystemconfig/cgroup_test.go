@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package operatingsystemconfig
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/gardener-extension-os-coreos/pkg/controller/operatingsystemconfig/coreos"
+	"github.com/gardener/gardener-extension-os-coreos/pkg/controller/operatingsystemconfig/ignition"
+)
+
+var _ = Describe("cgroup", func() {
+	DescribeTable("enableCGroups",
+		func(mode CgroupMode, expectedEnvironment string) {
+			cloudConfig := &coreos.CloudConfig{}
+
+			names, err := enableCGroups(cloudConfig, mode)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(names).To(ConsistOf(configureCgroupsUnitName))
+
+			Expect(cloudConfig.CoreOS.Units).To(ContainElement(And(
+				HaveField("Name", configureCgroupsUnitName),
+				HaveField("Content", ContainSubstring(expectedEnvironment)),
+			)))
+			Expect(cloudConfig.WriteFiles).To(ContainElement(
+				HaveField("Path", "/opt/bin/configure-cgroups.sh"),
+			))
+		},
+		Entry("auto", CgroupMode(""), "GARDENER_CGROUP_MODE=auto"),
+		Entry("explicit auto", CgroupModeAuto, "GARDENER_CGROUP_MODE=auto"),
+		Entry("v1", CgroupModeV1, "GARDENER_CGROUP_MODE=v1"),
+		Entry("v2", CgroupModeV2, "GARDENER_CGROUP_MODE=v2"),
+	)
+
+	DescribeTable("enableCGroupsIgnition",
+		func(mode CgroupMode, expectedEnvironment string) {
+			cfg := &ignition.Config{}
+
+			names, err := enableCGroupsIgnition(cfg, mode)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(names).To(ConsistOf(configureCgroupsUnitName))
+
+			Expect(cfg.Systemd.Units).To(ContainElement(And(
+				HaveField("Name", configureCgroupsUnitName),
+				HaveField("Contents", ContainSubstring(expectedEnvironment)),
+			)))
+			Expect(cfg.Storage.Files).To(ContainElement(
+				HaveField("Path", "/opt/bin/configure-cgroups.sh"),
+			))
+		},
+		Entry("auto", CgroupModeAuto, "GARDENER_CGROUP_MODE=auto"),
+		Entry("v1", CgroupModeV1, "GARDENER_CGROUP_MODE=v1"),
+		Entry("v2", CgroupModeV2, "GARDENER_CGROUP_MODE=v2"),
+	)
+})
@@ -37,6 +37,11 @@ func (a *actuator) legacyReconcile(ctx context.Context, config *extensionsv1alph
 }
 
 func (a *actuator) cloudConfigFromOperatingSystemConfig(ctx context.Context, config *extensionsv1alpha1.OperatingSystemConfig) (string, []string, []string, error) {
+	providerConfig, err := decodeProviderConfig(config)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
 	cloudConfig := &coreos.CloudConfig{
 		CoreOS: coreos.Config{
 			Update: coreos.Update{
@@ -153,7 +158,7 @@ WantedBy=containerd.service kubelet.service
 				RawFilePermissions: "0644",
 				Content: `[Service]
 SyslogIdentifier=containerd
-ExecStart=
+` + containerdDropInEnvironment() + `ExecStart=
 ExecStart=/bin/bash -c 'PATH="/run/torcx/unpack/docker/bin:$PATH" /run/torcx/unpack/docker/bin/containerd --config /etc/containerd/config.toml'
 `,
 			},
@@ -163,9 +168,30 @@ ExecStart=/bin/bash -c 'PATH="/run/torcx/unpack/docker/bin:$PATH" /run/torcx/unp
 				Content:            containerdTemplateContent,
 			})
 
+		snapshotterUnitNames, err := configureSnapshotter(cloudConfig, providerConfig.Snapshotter, providerConfig.SecurityProfiles)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		unitNames = append(unitNames, snapshotterUnitNames...)
+
+		if providerConfig.SecurityProfiles {
+			securityUnitNames, err := configureSecurityProfiles(cloudConfig)
+			if err != nil {
+				return "", nil, nil, err
+			}
+			unitNames = append(unitNames, securityUnitNames...)
+		}
+	}
+
+	if config.Spec.Purpose == extensionsv1alpha1.OperatingSystemConfigPurposeProvision {
+		kernelSettingsUnitNames, err := configureKernelSettings(cloudConfig, providerConfig.KernelSettings)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		unitNames = append(unitNames, kernelSettingsUnitNames...)
 	}
 
-	names, err := enableCGroupsV2(cloudConfig)
+	names, err := enableCGroups(cloudConfig, providerConfig.CgroupMode)
 	if err != nil {
 		return "", nil, nil, err
 	}
@@ -186,36 +212,3 @@ func isContainerdEnabled(criConfig *extensionsv1alpha1.CRIConfig) bool {
 
 	return criConfig.Name == extensionsv1alpha1.CRINameContainerD
 }
-
-func enableCGroupsV2(cloudConfig *coreos.CloudConfig) ([]string, error) {
-	var additionalUnitNames []string
-
-	cloudConfig.CoreOS.Units = append(
-		cloudConfig.CoreOS.Units,
-		coreos.Unit{
-			Name:    "enable-cgroupsv2.service",
-			Command: "start",
-			Enable:  true,
-			Content: `[Unit]
-Description=Oneshot unit used to patch the kubelet config for cgroupsv2.
-Before=containerd.service kubelet.service
-[Service]
-Type=oneshot
-EnvironmentFile=/etc/environment
-ExecStart=/opt/bin/configure-cgroupsv2.sh
-[Install]
-WantedBy=containerd.service kubelet.service
-`,
-		})
-	additionalUnitNames = append(additionalUnitNames, "enable-cgroupsv2.service")
-
-	cloudConfig.WriteFiles = append(
-		cloudConfig.WriteFiles,
-		coreos.File{
-			Path:               "/opt/bin/configure-cgroupsv2.sh",
-			RawFilePermissions: "0755",
-			Content:            cgroupsv2TemplateContent,
-		})
-
-	return additionalUnitNames, nil
-}
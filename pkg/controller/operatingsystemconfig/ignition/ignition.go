@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package ignition renders Ignition (spec v3.x) configs as an alternative to
+// the legacy coreos-cloudinit YAML produced by the coreos package. It is used
+// by Flatcar/Fedora CoreOS nodes which no longer ship coreos-cloudinit.
+package ignition
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+
+	"sigs.k8s.io/yaml"
+)
+
+// SpecVersion is the Ignition config spec version this package emits.
+const SpecVersion = "3.3.0"
+
+// Config mirrors the subset of the Ignition spec v3.x schema that this
+// extension needs to populate: storage.files, systemd.units (incl. dropins)
+// and passwd.
+type Config struct {
+	Ignition Ignition `json:"ignition"`
+	Storage  Storage  `json:"storage,omitempty"`
+	Systemd  Systemd  `json:"systemd,omitempty"`
+	Passwd   Passwd   `json:"passwd,omitempty"`
+}
+
+// Ignition carries the metadata Ignition itself requires to accept a config.
+type Ignition struct {
+	Version string `json:"version"`
+}
+
+// Storage holds the files to be written to disk during provisioning.
+type Storage struct {
+	Files []File `json:"files,omitempty"`
+}
+
+// File is a single entry under storage.files.
+type File struct {
+	Path      string       `json:"path"`
+	Mode      int          `json:"mode,omitempty"`
+	Overwrite *bool        `json:"overwrite,omitempty"`
+	Contents  FileContents `json:"contents"`
+}
+
+// FileContents references the file's content via a data: URL, per the
+// Ignition spec (remote HTTP(S)/S3 sources are not used by this extension).
+type FileContents struct {
+	Source string `json:"source"`
+}
+
+// Systemd holds the units to enable/mask/configure.
+type Systemd struct {
+	Units []Unit `json:"units,omitempty"`
+}
+
+// Unit is a single systemd.units[] entry, including its drop-ins.
+type Unit struct {
+	Name     string   `json:"name"`
+	Enabled  *bool    `json:"enabled,omitempty"`
+	Contents string   `json:"contents,omitempty"`
+	Mask     bool     `json:"mask,omitempty"`
+	Dropins  []Dropin `json:"dropins,omitempty"`
+}
+
+// Dropin is a single systemd.units[].dropins[] entry.
+type Dropin struct {
+	Name     string `json:"name"`
+	Contents string `json:"contents"`
+}
+
+// Passwd carries the passwd.users[] section. The extension currently never
+// populates it, but it is part of the spec sections this package mirrors.
+type Passwd struct {
+	Users []User `json:"users,omitempty"`
+}
+
+// User is a single passwd.users[] entry.
+type User struct {
+	Name              string   `json:"name"`
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys,omitempty"`
+}
+
+// NewFile builds a storage.files[] entry for the given path, decimal file
+// mode and content. isBinary selects the data URL encoding: base64 for
+// binary content, URL-escaped plain text otherwise (Ignition has no
+// intermediate "b64"/plain distinction like coreos-cloudinit, only the
+// data: URL scheme itself).
+func NewFile(path string, mode int, content []byte, isBinary bool) File {
+	return File{
+		Path: path,
+		Mode: mode,
+		Contents: FileContents{
+			Source: dataURL(content, isBinary),
+		},
+	}
+}
+
+func dataURL(content []byte, isBinary bool) string {
+	if isBinary {
+		return fmt.Sprintf("data:;base64,%s", base64.StdEncoding.EncodeToString(content))
+	}
+	return fmt.Sprintf("data:,%s", url.PathEscape(string(content)))
+}
+
+// butaneVariant/butaneVersion identify the Flatcar Butane dialect that
+// transpiles 1:1 into the Ignition spec version above.
+const (
+	butaneVariant = "flatcar"
+	butaneVersion = "1.0.0"
+)
+
+// butane is the YAML document Butane expects: the same storage/systemd/passwd
+// sections as Config, but flattened (no "ignition" wrapper) and tagged with a
+// variant/version header instead.
+type butane struct {
+	Variant string  `json:"variant"`
+	Version string  `json:"version"`
+	Storage Storage `json:"storage,omitempty"`
+	Systemd Systemd `json:"systemd,omitempty"`
+	Passwd  Passwd  `json:"passwd,omitempty"`
+}
+
+// ToButane renders cfg as Butane YAML, a human-readable intermediate that
+// transpiles into the same Ignition config. It exists purely for
+// operators/debugging; Gardener never applies it directly.
+func ToButane(cfg *Config) ([]byte, error) {
+	return yaml.Marshal(&butane{
+		Variant: butaneVariant,
+		Version: butaneVersion,
+		Storage: cfg.Storage,
+		Systemd: cfg.Systemd,
+		Passwd:  cfg.Passwd,
+	})
+}
@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package operatingsystemconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	actuatorutil "github.com/gardener/gardener/extensions/pkg/controller/operatingsystemconfig/oscommon/actuator"
+	extensionsv1alpha1 "github.com/gardener/gardener/pkg/apis/extensions/v1alpha1"
+
+	"github.com/gardener/gardener-extension-os-coreos/pkg/controller/operatingsystemconfig/ignition"
+)
+
+// formatAnnotation lets the OperatingSystemConfig opt into the Ignition
+// renderer explicitly; everything else keeps using the legacy
+// coreos-cloudinit YAML. It is deliberately not inferred from
+// ReloadConfigFilePath being nil: Provision-purpose configs never set that
+// path, so guessing from it would flip Ignition on for every node's initial
+// provisioning while its later Reconcile passes stayed on coreos-cloudinit -
+// two renderers disagreeing about the same node.
+//
+// butaneDebugAnnotation additionally writes the Butane YAML equivalent of
+// the generated Ignition config onto the node, for humans debugging it.
+const (
+	formatAnnotation      = "os.gardener.cloud/format"
+	formatIgnition        = "ignition"
+	butaneDebugAnnotation = "os.gardener.cloud/butane-debug"
+	butaneDebugFilePath   = "/etc/gardener/ignition-debug.bu"
+)
+
+// reconcile picks the renderer for the given OperatingSystemConfig: Ignition
+// when its formatAnnotation is set to "ignition", the legacy
+// coreos-cloudinit YAML otherwise. Ignition only runs once at provisioning time, so its userData
+// is returned with a nil reload command.
+//
+// This is the actuator's single OperatingSystemConfig-rendering entrypoint;
+// the oscommon Actuator's Reconcile/GenerateCloudConfig method must call
+// this and not legacyReconcile directly, or the Ignition path never runs.
+func (a *actuator) reconcile(ctx context.Context, config *extensionsv1alpha1.OperatingSystemConfig) ([]byte, *string, []string, []string, error) {
+	if usesIgnition(config) {
+		return a.ignitionReconcile(ctx, config)
+	}
+
+	return a.legacyReconcile(ctx, config)
+}
+
+func usesIgnition(config *extensionsv1alpha1.OperatingSystemConfig) bool {
+	return config.Annotations[formatAnnotation] == formatIgnition
+}
+
+func (a *actuator) ignitionReconcile(ctx context.Context, config *extensionsv1alpha1.OperatingSystemConfig) ([]byte, *string, []string, []string, error) {
+	userData, unitNames, filePaths, err := a.ignitionFromOperatingSystemConfig(ctx, config)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("could not generate ignition config: %v", err)
+	}
+
+	// Ignition only applies at first boot/provisioning, there is nothing to
+	// reload afterwards.
+	return userData, nil, unitNames, filePaths, nil
+}
+
+func (a *actuator) ignitionFromOperatingSystemConfig(ctx context.Context, config *extensionsv1alpha1.OperatingSystemConfig) ([]byte, []string, []string, error) {
+	providerConfig, err := decodeProviderConfig(config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	cfg := &ignition.Config{
+		Ignition: ignition.Ignition{Version: ignition.SpecVersion},
+	}
+
+	enabled, masked := true, true
+
+	cfg.Systemd.Units = append(cfg.Systemd.Units,
+		ignition.Unit{Name: "update-engine.service", Mask: masked},
+		ignition.Unit{Name: "locksmithd.service", Mask: masked},
+	)
+
+	if config.Spec.Purpose == extensionsv1alpha1.OperatingSystemConfigPurposeReconcile {
+		cfg.Storage.Files = append(cfg.Storage.Files,
+			ignition.NewFile("/etc/modprobe.d/sctp.conf", 0644, []byte("install sctp /bin/true"), false))
+	}
+
+	unitNames := make([]string, 0, len(config.Spec.Units))
+	for _, unit := range config.Spec.Units {
+		unitNames = append(unitNames, unit.Name)
+
+		u := ignition.Unit{Name: unit.Name}
+		if unit.Enable != nil {
+			u.Enabled = unit.Enable
+		}
+		if unit.Content != nil {
+			u.Contents = *unit.Content
+		}
+
+		for _, dropIn := range unit.DropIns {
+			u.Dropins = append(u.Dropins, ignition.Dropin{Name: dropIn.Name, Contents: dropIn.Content})
+		}
+
+		cfg.Systemd.Units = append(cfg.Systemd.Units, u)
+	}
+
+	filePaths := make([]string, 0, len(config.Spec.Files))
+	for _, file := range config.Spec.Files {
+		filePaths = append(filePaths, file.Path)
+
+		permissions := extensionsv1alpha1.OperatingSystemConfigDefaultFilePermission
+		if p := file.Permissions; p != nil {
+			permissions = *p
+		}
+
+		rawContent, err := actuatorutil.DataForFileContent(ctx, a.client, config.Namespace, &file.Content)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		isBinary := file.Content.TransmitUnencoded == nil || !*file.Content.TransmitUnencoded
+		if isBinary {
+			isBinary = !utf8.Valid(rawContent)
+		}
+
+		cfg.Storage.Files = append(cfg.Storage.Files, ignition.NewFile(file.Path, int(permissions), rawContent, isBinary))
+	}
+
+	if isContainerdEnabled(config.Spec.CRIConfig) && config.Spec.Purpose == extensionsv1alpha1.OperatingSystemConfigPurposeProvision {
+		cfg.Systemd.Units = append(cfg.Systemd.Units, ignition.Unit{
+			Name:    "run-command.service",
+			Enabled: &enabled,
+			Contents: `[Unit]
+Description=Oneshot unit used to run a script on node start-up.
+Before=containerd.service kubelet.service
+[Service]
+Type=oneshot
+EnvironmentFile=/etc/environment
+ExecStart=/opt/bin/run-command.sh
+[Install]
+WantedBy=containerd.service kubelet.service
+`,
+			Dropins: nil,
+		})
+		unitNames = append(unitNames, "run-command.service")
+
+		cfg.Storage.Files = append(cfg.Storage.Files,
+			ignition.NewFile("/etc/systemd/system/containerd.service.d/11-exec_config.conf", 0644, []byte(`[Service]
+SyslogIdentifier=containerd
+`+containerdDropInEnvironment()+`ExecStart=
+ExecStart=/bin/bash -c 'PATH="/run/torcx/unpack/docker/bin:$PATH" /run/torcx/unpack/docker/bin/containerd --config /etc/containerd/config.toml'
+`), false),
+			ignition.NewFile("/opt/bin/run-command.sh", 0755, []byte(containerdTemplateContent), false),
+		)
+
+		snapshotterUnitNames, err := configureSnapshotterIgnition(cfg, providerConfig.Snapshotter, providerConfig.SecurityProfiles)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		unitNames = append(unitNames, snapshotterUnitNames...)
+
+		if providerConfig.SecurityProfiles {
+			securityUnitNames, err := configureSecurityProfilesIgnition(cfg)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			unitNames = append(unitNames, securityUnitNames...)
+		}
+	}
+
+	if config.Spec.Purpose == extensionsv1alpha1.OperatingSystemConfigPurposeProvision {
+		kernelSettingsUnitNames, err := configureKernelSettingsIgnition(cfg, providerConfig.KernelSettings)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		unitNames = append(unitNames, kernelSettingsUnitNames...)
+	}
+
+	names, err := enableCGroupsIgnition(cfg, providerConfig.CgroupMode)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	unitNames = append(unitNames, names...)
+
+	if config.Annotations[butaneDebugAnnotation] == "true" {
+		butaneYAML, err := ignition.ToButane(cfg)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("could not render butane debug file: %v", err)
+		}
+
+		cfg.Storage.Files = append(cfg.Storage.Files, ignition.NewFile(butaneDebugFilePath, 0644, butaneYAML, false))
+		filePaths = append(filePaths, butaneDebugFilePath)
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not marshal ignition config: %v", err)
+	}
+
+	return data, unitNames, filePaths, nil
+}
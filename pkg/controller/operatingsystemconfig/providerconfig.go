@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package operatingsystemconfig
+
+import (
+	"encoding/json"
+	"fmt"
+
+	extensionsv1alpha1 "github.com/gardener/gardener/pkg/apis/extensions/v1alpha1"
+)
+
+// ProviderConfig is the coreos-specific configuration decoded from
+// OperatingSystemConfig.Spec.ProviderConfig. Every field is optional; the
+// zero value keeps today's defaults (auto-detect cgroups/snapshotter, no
+// kernel tuning overrides, no security profiles).
+type ProviderConfig struct {
+	// CgroupMode selects the cgroup hierarchy configure-cgroups.service
+	// assumes the node boots with.
+	CgroupMode CgroupMode `json:"cgroupMode,omitempty"`
+	// Snapshotter selects the containerd snapshotter to provision.
+	Snapshotter Snapshotter `json:"snapshotter,omitempty"`
+	// KernelSettings carries the conntrack/sysctl tunables written to
+	// /etc/sysctl.d/99-gardener-kube-proxy.conf.
+	KernelSettings KernelSettings `json:"kernelSettings,omitempty"`
+	// SecurityProfiles ships the default seccomp/AppArmor profiles for
+	// containerd.
+	SecurityProfiles bool `json:"securityProfiles,omitempty"`
+}
+
+// decodeProviderConfig decodes the coreos-specific ProviderConfig from the
+// OperatingSystemConfig. A config without a ProviderConfig set decodes to
+// the zero value.
+func decodeProviderConfig(config *extensionsv1alpha1.OperatingSystemConfig) (ProviderConfig, error) {
+	if config.Spec.ProviderConfig == nil || config.Spec.ProviderConfig.Raw == nil {
+		return ProviderConfig{}, nil
+	}
+
+	var providerConfig ProviderConfig
+	if err := json.Unmarshal(config.Spec.ProviderConfig.Raw, &providerConfig); err != nil {
+		return ProviderConfig{}, fmt.Errorf("could not decode provider config: %v", err)
+	}
+
+	return providerConfig, nil
+}
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package operatingsystemconfig
+
+import (
+	_ "embed"
+
+	"github.com/gardener/gardener-extension-os-coreos/pkg/controller/operatingsystemconfig/coreos"
+	"github.com/gardener/gardener-extension-os-coreos/pkg/controller/operatingsystemconfig/ignition"
+)
+
+const (
+	seccompProfilePath  = "/etc/containerd/seccomp-default.json"
+	apparmorProfilePath = "/etc/apparmor.d/containerd-default"
+
+	loadAppArmorUnitName = "load-apparmor-profiles.service"
+)
+
+//go:embed templates/seccomp-default.json
+var seccompDefaultProfileContent string
+
+//go:embed templates/apparmor-containerd
+var apparmorDefaultProfileContent string
+
+const loadAppArmorUnitContent = `[Unit]
+Description=Loads the default AppArmor profile for containerd.
+Before=containerd.service
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=/usr/sbin/apparmor_parser -r -W ` + apparmorProfilePath + `
+[Install]
+WantedBy=containerd.service
+`
+
+// configureSecurityProfiles ships the default seccomp/AppArmor profiles for
+// containerd on the coreos cloud-config renderer, following the pattern
+// CRI-O uses for its own default profiles.
+func configureSecurityProfiles(cloudConfig *coreos.CloudConfig) ([]string, error) {
+	cloudConfig.WriteFiles = append(cloudConfig.WriteFiles,
+		coreos.File{
+			Path:               seccompProfilePath,
+			RawFilePermissions: "0644",
+			Content:            seccompDefaultProfileContent,
+		},
+		coreos.File{
+			Path:               apparmorProfilePath,
+			RawFilePermissions: "0644",
+			Content:            apparmorDefaultProfileContent,
+		},
+	)
+
+	cloudConfig.CoreOS.Units = append(cloudConfig.CoreOS.Units, coreos.Unit{
+		Name:    loadAppArmorUnitName,
+		Command: "start",
+		Enable:  true,
+		Content: loadAppArmorUnitContent,
+	})
+
+	return []string{loadAppArmorUnitName}, nil
+}
+
+// configureSecurityProfilesIgnition is the Ignition-path equivalent of
+// configureSecurityProfiles.
+func configureSecurityProfilesIgnition(cfg *ignition.Config) ([]string, error) {
+	enabled := true
+
+	cfg.Storage.Files = append(cfg.Storage.Files,
+		ignition.NewFile(seccompProfilePath, 0644, []byte(seccompDefaultProfileContent), false),
+		ignition.NewFile(apparmorProfilePath, 0644, []byte(apparmorDefaultProfileContent), false),
+	)
+
+	cfg.Systemd.Units = append(cfg.Systemd.Units, ignition.Unit{
+		Name:     loadAppArmorUnitName,
+		Enabled:  &enabled,
+		Contents: loadAppArmorUnitContent,
+	})
+
+	return []string{loadAppArmorUnitName}, nil
+}
+
+// containerdSeccompConfigToml is appended to the snapshotter config.toml
+// fragment so containerd's CRI plugin runs with SystemdCgroup and the
+// default seccomp profile enabled. It relies on being appended while
+// [plugins."io.containerd.grpc.v1.cri".containerd] is still the open table
+// (snapshotterConfigToml does this) - reopening that header here would be a
+// duplicate table under strict TOML parsing.
+const containerdSeccompConfigToml = `  seccomp_profile = "` + seccompProfilePath + `"
+
+[plugins."io.containerd.grpc.v1.cri".containerd.default_runtime.options]
+  SystemdCgroup = true
+`
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package operatingsystemconfig
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/gardener-extension-os-coreos/pkg/controller/operatingsystemconfig/coreos"
+	"github.com/gardener/gardener-extension-os-coreos/pkg/controller/operatingsystemconfig/ignition"
+)
+
+var _ = Describe("securityprofiles", func() {
+	It("configureSecurityProfiles ships the seccomp/AppArmor profiles and the loader unit", func() {
+		cloudConfig := &coreos.CloudConfig{}
+
+		names, err := configureSecurityProfiles(cloudConfig)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).To(ConsistOf(loadAppArmorUnitName))
+
+		Expect(cloudConfig.WriteFiles).To(ContainElements(
+			HaveField("Path", seccompProfilePath),
+			HaveField("Path", apparmorProfilePath),
+		))
+		Expect(cloudConfig.CoreOS.Units).To(ContainElement(HaveField("Name", loadAppArmorUnitName)))
+	})
+
+	It("configureSecurityProfilesIgnition ships the seccomp/AppArmor profiles and the loader unit", func() {
+		cfg := &ignition.Config{}
+
+		names, err := configureSecurityProfilesIgnition(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).To(ConsistOf(loadAppArmorUnitName))
+
+		Expect(cfg.Storage.Files).To(ContainElements(
+			HaveField("Path", seccompProfilePath),
+			HaveField("Path", apparmorProfilePath),
+		))
+		Expect(cfg.Systemd.Units).To(ContainElement(HaveField("Name", loadAppArmorUnitName)))
+	})
+
+	It("includes the SystemdCgroup and seccomp_profile settings in config.toml only when enabled", func() {
+		Expect(snapshotterConfigToml(SnapshotterOverlayfs, false)).NotTo(ContainSubstring("SystemdCgroup"))
+		Expect(snapshotterConfigToml(SnapshotterOverlayfs, true)).To(ContainSubstring("SystemdCgroup = true"))
+		Expect(snapshotterConfigToml(SnapshotterOverlayfs, true)).To(ContainSubstring(seccompProfilePath))
+	})
+})
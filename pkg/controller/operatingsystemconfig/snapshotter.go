@@ -0,0 +1,240 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package operatingsystemconfig
+
+import (
+	_ "embed"
+	"fmt"
+
+	"github.com/gardener/gardener-extension-os-coreos/pkg/controller/operatingsystemconfig/coreos"
+	"github.com/gardener/gardener-extension-os-coreos/pkg/controller/operatingsystemconfig/ignition"
+)
+
+// Snapshotter selects the containerd snapshotter to provision. It is sourced
+// from the provider config, mirroring CgroupMode.
+type Snapshotter string
+
+const (
+	// SnapshotterAuto probes the kernel/filesystem at boot via
+	// detect-containerd-snapshotter.service, preferring overlayfs, then
+	// fuse-overlayfs, then native.
+	SnapshotterAuto Snapshotter = "auto"
+	// SnapshotterOverlayfs uses containerd's native overlayfs snapshotter.
+	SnapshotterOverlayfs Snapshotter = "overlayfs"
+	// SnapshotterFuseOverlayfs uses the fuse-overlayfs proxy plugin, for
+	// rootless-friendly setups or kernels without native overlay support.
+	SnapshotterFuseOverlayfs Snapshotter = "fuse-overlayfs"
+	// SnapshotterNative uses containerd's native snapshotter, for
+	// filesystems that don't support overlay at all.
+	SnapshotterNative Snapshotter = "native"
+)
+
+const (
+	detectSnapshotterUnitName = "detect-containerd-snapshotter.service"
+	// snapshotterEnvPath must survive reboots: render-containerd-snapshotter-config.sh
+	// runs as an ExecStartPre of containerd.service on every start, including
+	// for statically-configured snapshotters that have no unit to
+	// regenerate it. /run is tmpfs and would be empty after the first
+	// reboot, failing containerd.service forever.
+	snapshotterEnvPath = "/etc/containerd/snapshotter.env"
+	// snapshotterConfigPath is a dedicated drop-in, not the main
+	// /etc/containerd/config.toml: that file is owned by the CRIConfig
+	// file list and writing our fragment over it would clobber whatever
+	// those files configured. render-containerd-snapshotter-config.sh
+	// makes sure the main config imports this drop-in.
+	snapshotterConfigPath   = "/etc/containerd/conf.d/20-gardener-snapshotter.toml"
+	fuseOverlayfsSocketPath = "/run/containerd-fuse-overlayfs-grpc/containerd-fuse-overlayfs-grpc.sock"
+)
+
+//go:embed templates/detect-containerd-snapshotter.sh.tpl
+var detectSnapshotterTemplateContent string
+
+//go:embed templates/render-containerd-snapshotter-config.sh.tpl
+var renderSnapshotterConfigTemplateContent string
+
+// containerdDropInEnvironment returns the drop-in fragment that must be
+// merged into the containerd.service.d exec-override drop-in so that
+// whichever snapshotter was resolved (statically or via detection) is
+// rendered into config.toml right before containerd starts.
+func containerdDropInEnvironment() string {
+	return `EnvironmentFile=-` + snapshotterEnvPath + `
+ExecStartPre=/opt/bin/render-containerd-snapshotter-config.sh
+`
+}
+
+func snapshotterConfigToml(snapshotter Snapshotter, securityProfiles bool) string {
+	value := snapshotter
+	if value == "" || value == SnapshotterAuto {
+		// placeholder: render-containerd-snapshotter-config.sh replaces it
+		// with the value detect-containerd-snapshotter.service resolved;
+		// containerd does not start while snapshotter.env is missing
+		value = SnapshotterOverlayfs
+	}
+
+	toml := fmt.Sprintf(`[plugins."io.containerd.grpc.v1.cri".containerd]
+  snapshotter = %q
+`, value)
+
+	if securityProfiles {
+		// Must stay in the same table header opened above: a strict TOML
+		// parser rejects [plugins."io.containerd.grpc.v1.cri".containerd]
+		// being declared twice in one document.
+		toml += containerdSeccompConfigToml
+	}
+
+	if snapshotter == SnapshotterFuseOverlayfs || snapshotter == SnapshotterAuto || snapshotter == "" {
+		toml += fmt.Sprintf(`
+[proxy_plugins]
+  [proxy_plugins.fuse-overlayfs]
+    type = "snapshot"
+    address = %q
+`, fuseOverlayfsSocketPath)
+	}
+
+	return toml
+}
+
+// fuseOverlayfsProxyPluginUnitContent starts the containerd-fuse-overlayfs-grpc
+// proxy plugin daemon. This extension does not stage that binary itself -
+// it must be installed onto the image (e.g. via the OS package set) at
+// /opt/bin/containerd-fuse-overlayfs-grpc. ExecStartPre checks for it
+// explicitly so a missing prerequisite fails loudly at unit start instead
+// of leaving the CRI plugin pointed at a dead proxy_plugins socket.
+func fuseOverlayfsProxyPluginUnitContent() string {
+	return `[Unit]
+Description=fuse-overlayfs proxy snapshotter for containerd
+Before=containerd.service
+[Service]
+Type=notify
+ExecStartPre=/usr/bin/test -x /opt/bin/containerd-fuse-overlayfs-grpc
+ExecStart=/opt/bin/containerd-fuse-overlayfs-grpc ` + fuseOverlayfsSocketPath + ` /var/lib/containerd/io.containerd.snapshotter.v1.fuse-overlayfs
+[Install]
+WantedBy=containerd.service
+`
+}
+
+func snapshotterEnvContent(snapshotter Snapshotter) string {
+	return fmt.Sprintf("CONTAINERD_SNAPSHOTTER=%s\n", snapshotter)
+}
+
+// configureSnapshotter wires up the containerd snapshotter for the coreos
+// cloud-config renderer: a static config.toml fragment, a boot-time
+// detection unit for "auto" (a static snapshotter.env otherwise), and the
+// fuse-overlayfs proxy plugin unit for "fuse-overlayfs" and "auto".
+// Returns the additional unit names to report back to Gardener.
+func configureSnapshotter(cloudConfig *coreos.CloudConfig, snapshotter Snapshotter, securityProfiles bool) ([]string, error) {
+	var unitNames []string
+
+	cloudConfig.WriteFiles = append(cloudConfig.WriteFiles,
+		coreos.File{
+			Path:               snapshotterConfigPath,
+			RawFilePermissions: "0644",
+			Content:            snapshotterConfigToml(snapshotter, securityProfiles),
+		},
+		coreos.File{
+			Path:               "/opt/bin/render-containerd-snapshotter-config.sh",
+			RawFilePermissions: "0755",
+			Content:            renderSnapshotterConfigTemplateContent,
+		},
+	)
+
+	switch snapshotter {
+	case SnapshotterAuto, "":
+		cloudConfig.CoreOS.Units = append(cloudConfig.CoreOS.Units, coreos.Unit{
+			Name:    detectSnapshotterUnitName,
+			Command: "start",
+			Enable:  true,
+			Content: `[Unit]
+Description=Oneshot unit used to probe and resolve the containerd snapshotter.
+Before=containerd.service
+[Service]
+Type=oneshot
+EnvironmentFile=/etc/environment
+ExecStart=/opt/bin/detect-containerd-snapshotter.sh
+[Install]
+WantedBy=containerd.service
+`,
+		})
+		unitNames = append(unitNames, detectSnapshotterUnitName)
+
+		cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, coreos.File{
+			Path:               "/opt/bin/detect-containerd-snapshotter.sh",
+			RawFilePermissions: "0755",
+			Content:            detectSnapshotterTemplateContent,
+		})
+	default:
+		cloudConfig.WriteFiles = append(cloudConfig.WriteFiles, coreos.File{
+			Path:               snapshotterEnvPath,
+			RawFilePermissions: "0644",
+			Content:            snapshotterEnvContent(snapshotter),
+		})
+	}
+
+	// SnapshotterAuto also needs the proxy plugin unit available: the
+	// fuse-overlayfs proxy_plugins stanza is shipped for it above, and
+	// detection at boot can resolve to fuse-overlayfs.
+	if snapshotter == SnapshotterFuseOverlayfs || snapshotter == SnapshotterAuto || snapshotter == "" {
+		cloudConfig.CoreOS.Units = append(cloudConfig.CoreOS.Units, coreos.Unit{
+			Name:    "containerd-fuse-overlayfs.service",
+			Command: "start",
+			Enable:  true,
+			Content: fuseOverlayfsProxyPluginUnitContent(),
+		})
+		unitNames = append(unitNames, "containerd-fuse-overlayfs.service")
+	}
+
+	return unitNames, nil
+}
+
+// configureSnapshotterIgnition is the Ignition-path equivalent of
+// configureSnapshotter.
+func configureSnapshotterIgnition(cfg *ignition.Config, snapshotter Snapshotter, securityProfiles bool) ([]string, error) {
+	var unitNames []string
+	enabled := true
+
+	cfg.Storage.Files = append(cfg.Storage.Files,
+		ignition.NewFile(snapshotterConfigPath, 0644, []byte(snapshotterConfigToml(snapshotter, securityProfiles)), false),
+		ignition.NewFile("/opt/bin/render-containerd-snapshotter-config.sh", 0755, []byte(renderSnapshotterConfigTemplateContent), false),
+	)
+
+	switch snapshotter {
+	case SnapshotterAuto, "":
+		cfg.Systemd.Units = append(cfg.Systemd.Units, ignition.Unit{
+			Name:    detectSnapshotterUnitName,
+			Enabled: &enabled,
+			Contents: `[Unit]
+Description=Oneshot unit used to probe and resolve the containerd snapshotter.
+Before=containerd.service
+[Service]
+Type=oneshot
+EnvironmentFile=/etc/environment
+ExecStart=/opt/bin/detect-containerd-snapshotter.sh
+[Install]
+WantedBy=containerd.service
+`,
+		})
+		unitNames = append(unitNames, detectSnapshotterUnitName)
+
+		cfg.Storage.Files = append(cfg.Storage.Files,
+			ignition.NewFile("/opt/bin/detect-containerd-snapshotter.sh", 0755, []byte(detectSnapshotterTemplateContent), false))
+	default:
+		cfg.Storage.Files = append(cfg.Storage.Files,
+			ignition.NewFile(snapshotterEnvPath, 0644, []byte(snapshotterEnvContent(snapshotter)), false))
+	}
+
+	// SnapshotterAuto also needs the proxy plugin unit available: the
+	// fuse-overlayfs proxy_plugins stanza is shipped for it above, and
+	// detection at boot can resolve to fuse-overlayfs.
+	if snapshotter == SnapshotterFuseOverlayfs || snapshotter == SnapshotterAuto || snapshotter == "" {
+		cfg.Systemd.Units = append(cfg.Systemd.Units, ignition.Unit{
+			Name:     "containerd-fuse-overlayfs.service",
+			Enabled:  &enabled,
+			Contents: fuseOverlayfsProxyPluginUnitContent(),
+		})
+		unitNames = append(unitNames, "containerd-fuse-overlayfs.service")
+	}
+
+	return unitNames, nil
+}
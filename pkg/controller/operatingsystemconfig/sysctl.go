@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package operatingsystemconfig
+
+import (
+	"fmt"
+
+	"github.com/gardener/gardener-extension-os-coreos/pkg/controller/operatingsystemconfig/coreos"
+	"github.com/gardener/gardener-extension-os-coreos/pkg/controller/operatingsystemconfig/ignition"
+)
+
+// KernelSettings carries the conntrack/sysctl tunables written to
+// /etc/sysctl.d/99-gardener-kube-proxy.conf. Unset fields fall back to the
+// package defaults below. It is sourced from the provider config, mirroring
+// CgroupMode and Snapshotter.
+type KernelSettings struct {
+	// NfConntrackMax overrides net.netfilter.nf_conntrack_max. Raise this on
+	// large nodes that would otherwise exhaust the conntrack table.
+	NfConntrackMax *int32 `json:"nfConntrackMax,omitempty"`
+	// NfConntrackTCPTimeoutCloseWait overrides
+	// net.netfilter.nf_conntrack_tcp_timeout_close_wait.
+	NfConntrackTCPTimeoutCloseWait *int32 `json:"nfConntrackTCPTimeoutCloseWait,omitempty"`
+	// NfConntrackTCPTimeoutEstablished overrides
+	// net.netfilter.nf_conntrack_tcp_timeout_established.
+	NfConntrackTCPTimeoutEstablished *int32 `json:"nfConntrackTCPTimeoutEstablished,omitempty"`
+}
+
+const (
+	defaultNfConntrackMax                   = 131072
+	defaultNfConntrackTCPTimeoutCloseWait   = 3600
+	defaultNfConntrackTCPTimeoutEstablished = 86400
+	sysctlConfPath                          = "/etc/sysctl.d/99-gardener-kube-proxy.conf"
+	modulesLoadConfPath                     = "/etc/modules-load.d/gardener.conf"
+	sysctlUnitName                          = "systemd-sysctl-gardener.service"
+)
+
+func (ks KernelSettings) nfConntrackMax() int32 {
+	if ks.NfConntrackMax != nil {
+		return *ks.NfConntrackMax
+	}
+	return defaultNfConntrackMax
+}
+
+func (ks KernelSettings) nfConntrackTCPTimeoutCloseWait() int32 {
+	if ks.NfConntrackTCPTimeoutCloseWait != nil {
+		return *ks.NfConntrackTCPTimeoutCloseWait
+	}
+	return defaultNfConntrackTCPTimeoutCloseWait
+}
+
+func (ks KernelSettings) nfConntrackTCPTimeoutEstablished() int32 {
+	if ks.NfConntrackTCPTimeoutEstablished != nil {
+		return *ks.NfConntrackTCPTimeoutEstablished
+	}
+	return defaultNfConntrackTCPTimeoutEstablished
+}
+
+// sysctlConfContent renders /etc/sysctl.d/99-gardener-kube-proxy.conf so
+// kube-proxy doesn't have to write these values itself from an unprivileged
+// pod, the same reasoning k3s's agent uses for setting them centrally.
+func sysctlConfContent(ks KernelSettings) string {
+	return fmt.Sprintf(`net.netfilter.nf_conntrack_max = %d
+net.netfilter.nf_conntrack_tcp_timeout_close_wait = %d
+net.netfilter.nf_conntrack_tcp_timeout_established = %d
+net.ipv4.ip_forward = 1
+net.bridge.bridge-nf-call-iptables = 1
+`, ks.nfConntrackMax(), ks.nfConntrackTCPTimeoutCloseWait(), ks.nfConntrackTCPTimeoutEstablished())
+}
+
+const modulesLoadConfContent = `br_netfilter
+nf_conntrack
+`
+
+const sysctlUnitContent = `[Unit]
+Description=Loads the kernel modules and applies the sysctl tuning kube-proxy/conntrack need.
+Before=kube-proxy.service kubelet.service
+[Service]
+Type=oneshot
+ExecStartPre=/sbin/modprobe br_netfilter
+ExecStartPre=/sbin/modprobe nf_conntrack
+ExecStart=/bin/systemctl restart systemd-sysctl
+[Install]
+WantedBy=kubelet.service
+`
+
+// configureKernelSettings provisions the kube-proxy/conntrack sysctl
+// tuning for the coreos cloud-config renderer.
+func configureKernelSettings(cloudConfig *coreos.CloudConfig, ks KernelSettings) ([]string, error) {
+	cloudConfig.WriteFiles = append(cloudConfig.WriteFiles,
+		coreos.File{
+			Path:               sysctlConfPath,
+			RawFilePermissions: "0644",
+			Content:            sysctlConfContent(ks),
+		},
+		coreos.File{
+			Path:               modulesLoadConfPath,
+			RawFilePermissions: "0644",
+			Content:            modulesLoadConfContent,
+		},
+	)
+
+	cloudConfig.CoreOS.Units = append(cloudConfig.CoreOS.Units, coreos.Unit{
+		Name:    sysctlUnitName,
+		Command: "start",
+		Enable:  true,
+		Content: sysctlUnitContent,
+	})
+
+	return []string{sysctlUnitName}, nil
+}
+
+// configureKernelSettingsIgnition is the Ignition-path equivalent of
+// configureKernelSettings.
+func configureKernelSettingsIgnition(cfg *ignition.Config, ks KernelSettings) ([]string, error) {
+	enabled := true
+
+	cfg.Storage.Files = append(cfg.Storage.Files,
+		ignition.NewFile(sysctlConfPath, 0644, []byte(sysctlConfContent(ks)), false),
+		ignition.NewFile(modulesLoadConfPath, 0644, []byte(modulesLoadConfContent), false),
+	)
+
+	cfg.Systemd.Units = append(cfg.Systemd.Units, ignition.Unit{
+		Name:     sysctlUnitName,
+		Enabled:  &enabled,
+		Contents: sysctlUnitContent,
+	})
+
+	return []string{sysctlUnitName}, nil
+}